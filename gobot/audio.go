@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/gdraynz/go-discord/discord"
+)
+
+// queueDepth bounds how many pending plays a guild can queue before
+// Enqueue starts dropping requests instead of silently racing them.
+const queueDepth = 6
+
+// PlayRequest is one clip queued for a guild's voice channel. Next lets a
+// caller chain several clips as a single logical request (e.g. an intro
+// followed by the real clip) without the queue reordering them around
+// someone else's request.
+type PlayRequest struct {
+	GuildID string
+	Channel discord.Channel
+	Source  string
+	Next    *PlayRequest
+}
+
+// AudioPlayer serializes voice playback per guild: each guild gets its
+// own bounded queue and a dedicated goroutine draining it, so two
+// "!go voice" triggers firing at once queue up instead of both racing to
+// open the same voice connection.
+type AudioPlayer struct {
+	client *discord.Client
+
+	mu     sync.Mutex
+	queues map[string]chan *PlayRequest
+}
+
+// NewAudioPlayer wires an AudioPlayer to client, whose SendAudio every
+// queued request eventually goes through.
+func NewAudioPlayer(client *discord.Client) *AudioPlayer {
+	return &AudioPlayer{
+		client: client,
+		queues: make(map[string]chan *PlayRequest),
+	}
+}
+
+// Enqueue queues req (and anything chained via req.Next) for playback on
+// its guild, starting that guild's drain goroutine on first use. It
+// returns false, dropping the request, if the guild's queue is full.
+func (p *AudioPlayer) Enqueue(req *PlayRequest) bool {
+	select {
+	case p.queueFor(req.GuildID) <- req:
+		return true
+	default:
+		log.Printf("Dropping audio request for guild %s: queue full", req.GuildID)
+		return false
+	}
+}
+
+// queueFor returns guildID's queue, creating it (and its drain goroutine)
+// on first use.
+func (p *AudioPlayer) queueFor(guildID string) chan *PlayRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	queue, ok := p.queues[guildID]
+	if !ok {
+		queue = make(chan *PlayRequest, queueDepth)
+		p.queues[guildID] = queue
+		go p.drain(queue)
+	}
+	return queue
+}
+
+// drain plays every request queued on queue, one at a time, for as long
+// as the process runs: there's exactly one of these per guild that's
+// ever queued audio, which is what keeps playback serialized.
+func (p *AudioPlayer) drain(queue chan *PlayRequest) {
+	for req := range queue {
+		for r := req; r != nil; r = r.Next {
+			if err := p.client.SendAudio(r.Channel, r.Source); err != nil {
+				log.Printf("Error playing %s: %s", r.Source, err.Error())
+			}
+		}
+	}
+}
+
+// Pending returns the number of requests currently queued for guildID.
+func (p *AudioPlayer) Pending(guildID string) int {
+	p.mu.Lock()
+	queue, ok := p.queues[guildID]
+	p.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	return len(queue)
+}
+
+// Stop drains every request currently queued for guildID without
+// playing them, and reports how many were dropped. It doesn't interrupt
+// a clip that's already playing.
+func (p *AudioPlayer) Stop(guildID string) int {
+	p.mu.Lock()
+	queue, ok := p.queues[guildID]
+	p.mu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	dropped := 0
+	for {
+		select {
+		case <-queue:
+			dropped++
+		default:
+			return dropped
+		}
+	}
+}
+
+// stopCmd implements "!go stop": drains the current guild's pending
+// audio queue without interrupting whatever's already playing.
+type stopCmd struct{}
+
+func (stopCmd) Help() string  { return "Drains the pending voice-clip queue for this server" }
+func (stopCmd) Usage() string { return "stop" }
+
+func (stopCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	server := msg.GetServer(&client)
+	dropped := audioPlayer.Stop(server.ID)
+	if dropped == 0 {
+		return "Nothing queued.", nil
+	}
+	return fmt.Sprintf("Dropped %d queued clip(s).", dropped), nil
+}
+
+// queueCmd implements "!go queue": reports how many clips are waiting to
+// play for this server.
+type queueCmd struct{}
+
+func (queueCmd) Help() string  { return "Shows how many voice clips are queued for this server" }
+func (queueCmd) Usage() string { return "queue" }
+
+func (queueCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	pending := audioPlayer.Pending(msg.GetServer(&client).ID)
+	if pending == 0 {
+		return "Nothing queued.", nil
+	}
+	return fmt.Sprintf("%d clip(s) queued.", pending), nil
+}
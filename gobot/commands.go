@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/gdraynz/go-discord/discord"
+)
+
+// helpCmd implements "!go help": it lists every registered command,
+// itself included, via CommandRegistry.HelpText.
+type helpCmd struct{}
+
+func (helpCmd) Help() string  { return "Prints this help message" }
+func (helpCmd) Usage() string { return "help" }
+
+func (helpCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	return registry.HelpText(), nil
+}
+
+// reminderCmd implements "!go reminder <duration> [message...]".
+type reminderCmd struct{}
+
+func (reminderCmd) Help() string {
+	return "Reminds you of something in X hours Y minutes Z seconds"
+}
+func (reminderCmd) Usage() string { return "reminder <time [XhYmZs]> [<message>]" }
+
+func (reminderCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	var parsed struct {
+		Duration time.Duration `arg:"duration"`
+		Message  string        `arg:"message,rest"`
+	}
+	if err := parseArgs(&parsed, args); err != nil {
+		return nil, err
+	}
+
+	reminderMessage := fmt.Sprintf("@%s ping !", msg.Author.Name)
+	if parsed.Message != "" {
+		reminderMessage = fmt.Sprintf("@%s %s !", msg.Author.Name, parsed.Message)
+	}
+
+	log.Printf("Reminding %s in %s", msg.Author.Name, parsed.Duration.String())
+	time.AfterFunc(parsed.Duration, func() {
+		client.SendMessageMention(msg.ChannelID, reminderMessage, []discord.User{msg.Author})
+	})
+
+	return fmt.Sprintf("Aight! I will ping you in %s.", parsed.Duration.String()), nil
+}
+
+// statsCmd implements "!go stats".
+type statsCmd struct{}
+
+func (statsCmd) Help() string  { return "Prints bot statistics" }
+func (statsCmd) Usage() string { return "stats" }
+
+func (statsCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	return fmt.Sprintf("Bot statistics:\n"+
+		"`Memory used` %.2f Mb\n"+
+		"`Users in touch` %s\n"+
+		"`Uptime` %s\n"+
+		"`Concurrent tasks` %d\n"+
+		"`Commands answered` %d",
+		float64(stats.Alloc)/1000000,
+		getUserCountString(),
+		getDurationString(time.Now().Sub(startTime)),
+		runtime.NumGoroutine(),
+		totalCommands,
+	), nil
+}
+
+// sourceCmd implements "!go source".
+type sourceCmd struct{}
+
+func (sourceCmd) Help() string  { return "Shows the bot's source URL" }
+func (sourceCmd) Usage() string { return "source" }
+
+func (sourceCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	return "https://github.com/gdraynz/go-discord", nil
+}
+
+// avatarCmd implements "!go avatar".
+type avatarCmd struct{}
+
+func (avatarCmd) Help() string  { return "Shows your avatar URL" }
+func (avatarCmd) Usage() string { return "avatar" }
+
+func (avatarCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	return msg.Author.GetAvatarURL(), nil
+}
+
+// voiceCmd implements "!go voice": queues a clip on the caller's guild's
+// General channel. Restricted to steelou, as before. Queueing through
+// audioPlayer rather than calling client.SendAudio directly means two
+// triggers in quick succession play back to back instead of racing each
+// other for the same voice connection.
+type voiceCmd struct{}
+
+func (voiceCmd) Help() string  { return "Plays a sound in the General voice channel" }
+func (voiceCmd) Usage() string { return "voice" }
+
+func (voiceCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	if msg.Author.Name != "steelou" {
+		return "Nah.", nil
+	}
+
+	server := msg.GetServer(&client)
+	voiceChannel := client.GetChannel(server, "General")
+	audioPlayer.Enqueue(&PlayRequest{GuildID: server.ID, Channel: voiceChannel, Source: "Blue.mp3"})
+	return nil, nil
+}
+
+// playedCmd implements "!go played".
+type playedCmd struct{}
+
+func (playedCmd) Help() string  { return "Shows your play time" }
+func (playedCmd) Usage() string { return "played" }
+
+func (playedCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	gameTime, err := counter.GetUserGametime(msg.Author)
+	if err != nil || len(gameTime) == 0 {
+		return "Seems you played nothing since I'm up :(", nil
+	}
+
+	pString := "As far as I'm aware, you played:\n"
+	for strGameID, playtime := range gameTime {
+		id, err := strconv.Atoi(strGameID)
+		if err != nil {
+			return "Seems like I just broke. :|", nil
+		}
+		pString += fmt.Sprintf(
+			"`%s` %s\n",
+			games[id].Name,
+			getDurationString(time.Duration(playtime)),
+		)
+	}
+	return pString, nil
+}
+
+// idleCmd implements "!go idle": lists every session TimeCounter is
+// currently tracking, with elapsed playtime and time since last seen, so
+// a stuck session can be spotted before IdleTimeout catches up to it.
+// Restricted to steelou, same as voiceCmd: it dumps everyone's current
+// game and how long ago each of them was last seen.
+type idleCmd struct{}
+
+func (idleCmd) Help() string {
+	return "Admin: lists currently-tracked sessions and their last-seen delta"
+}
+func (idleCmd) Usage() string { return "idle" }
+
+func (idleCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	if msg.Author.Name != "steelou" {
+		return "Nah.", nil
+	}
+
+	sessions := counter.Sessions()
+	if len(sessions) == 0 {
+		return "Nobody's being tracked right now.", nil
+	}
+
+	now := time.Now()
+	listing := "Tracked sessions:\n"
+	for _, pUser := range sessions {
+		gameName := "something"
+		if id, err := strconv.Atoi(pUser.GameID); err == nil {
+			if game, ok := games[id]; ok {
+				gameName = game.Name
+			}
+		}
+		listing += fmt.Sprintf(
+			"`%s` playing %s for %s, last seen %s ago\n",
+			pUser.UserID,
+			gameName,
+			getDurationString(now.Sub(pUser.StartTime)),
+			getDurationString(now.Sub(pUser.LastSeen)),
+		)
+	}
+	return listing, nil
+}
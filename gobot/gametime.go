@@ -1,146 +1,194 @@
 package main
 
 import (
-	"encoding/binary"
-	"errors"
-	"flag"
+	"context"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/gdraynz/go-discord/discord"
 )
 
-var (
-	flagDB = flag.String("db", "gametime.db", "DB file for game time")
-)
+// DefaultIdleTimeout is how long a tracked session can go without any
+// observed activity (a presence update or any message) before Listen force-
+// closes it. It guards against a missed presence transition -- a
+// reconnect, a dropped gateway event, a ghost presence -- leaving someone
+// "playing" for days.
+const DefaultIdleTimeout = 30 * time.Minute
+
+// idleCheckInterval is how often Listen scans InProgress for idle sessions.
+const idleCheckInterval = time.Minute
 
 type PlayingUser struct {
 	UserID    string
 	StartTime time.Time
 	GameID    string
-}
-
-func (p *PlayingUser) SaveGametime(t *bolt.Tx) error {
-	b, err := t.CreateBucketIfNotExists([]byte(p.UserID))
-	if err != nil {
-		return err
-	}
-	bPlayed := b.Get([]byte(p.GameID))
-	if bPlayed != nil {
-		// bytes to int64
-		played, _ := binary.Varint(bPlayed)
-
-		// Calc total time
-		total := time.Now().Add(time.Duration(played))
-
-		// int64 to bytes
-		newPlayed := make([]byte, binary.MaxVarintLen64)
-		binary.PutVarint(newPlayed, total.Sub(p.StartTime).Nanoseconds())
-
-		if err := b.Put([]byte(p.GameID), newPlayed); err != nil {
-			return err
-		}
-	} else {
-		// int64 to bytes
-		newPlayed := make([]byte, binary.MaxVarintLen64)
-		binary.PutVarint(newPlayed, time.Since(p.StartTime).Nanoseconds())
-
-		if err := b.Put([]byte(p.GameID), newPlayed); err != nil {
-			return err
-		}
-	}
-	// Update start time
-	p.StartTime = time.Now()
-	return nil
+	LastSeen  time.Time
 }
 
 type TimeCounter struct {
+	// mu guards InProgress: onReady/gameStarted/messageReceived can all
+	// touch it from different goroutines, on top of Listen's own
+	// idle-kick and end-of-session handling.
+	mu           sync.Mutex
 	InProgress   map[string]PlayingUser
-	GametimeDB   *bolt.DB
+	Store        GametimeStore
 	GametimeChan chan PlayingUser
+	IdleTimeout  time.Duration
 }
 
-func NewCounter() (*TimeCounter, error) {
-	var t *TimeCounter
-
-	db, err := bolt.Open(*flagDB, 0600, nil)
-	if err != nil {
-		return t, err
-	}
-
+// NewCounter wires a TimeCounter to the given store. The store is picked by
+// main() based on the -store flag; idleTimeout is the -idle-timeout flag.
+func NewCounter(store GametimeStore, idleTimeout time.Duration) (*TimeCounter, error) {
 	return &TimeCounter{
 		InProgress:   make(map[string]PlayingUser),
-		GametimeDB:   db,
+		Store:        store,
 		GametimeChan: make(chan PlayingUser),
+		IdleTimeout:  idleTimeout,
 	}, nil
 }
 
 func (counter *TimeCounter) Listen() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
 	for {
-		pUser := <-counter.GametimeChan
-		go counter.EndGametime(pUser)
+		select {
+		case pUser := <-counter.GametimeChan:
+			go counter.EndGametime(pUser)
+		case <-ticker.C:
+			counter.kickIdle()
+		}
+	}
+}
+
+// kickIdle force-ends every session whose LastSeen is older than
+// IdleTimeout, crediting time up to LastSeen rather than now so the idle
+// gap itself isn't counted as playtime.
+func (counter *TimeCounter) kickIdle() {
+	cutoff := time.Now().Add(-counter.IdleTimeout)
+
+	counter.mu.Lock()
+	var stale []PlayingUser
+	for _, pUser := range counter.InProgress {
+		if pUser.LastSeen.After(cutoff) {
+			continue
+		}
+		stale = append(stale, pUser)
+		delete(counter.InProgress, pUser.UserID)
+	}
+	counter.mu.Unlock()
+
+	for _, pUser := range stale {
+		log.Printf("Kicked idle: %s last seen %s ago", pUser.UserID, time.Since(pUser.LastSeen))
+		if err := counter.Store.EndSession(pUser.UserID, pUser.GameID, pUser.StartTime, pUser.LastSeen); err != nil {
+			log.Printf("Error while ending idle session : %s", err.Error())
+		}
 	}
 }
 
 func (counter *TimeCounter) StartGametime(user discord.User, game discord.Game) {
 	log.Printf("Starting to count for %s on %s", user.Name, game.Name)
 
+	now := time.Now()
 	pUser := PlayingUser{
 		UserID:    user.ID,
-		GameID:    string(game.ID),
-		StartTime: time.Now(),
+		GameID:    strconv.Itoa(game.ID),
+		StartTime: now,
+		LastSeen:  now,
 	}
 
+	counter.mu.Lock()
 	counter.InProgress[user.ID] = pUser
+	counter.mu.Unlock()
+
+	if err := counter.Store.StartSession(pUser.UserID, pUser.GameID, pUser.StartTime); err != nil {
+		log.Printf("Error while starting game time : %s", err.Error())
+	}
+}
+
+// Touch records that userID was just observed (a presence update or any
+// message), resetting their idle clock. It's a no-op if userID has no
+// in-progress session.
+func (counter *TimeCounter) Touch(userID string) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	pUser, ok := counter.InProgress[userID]
+	if !ok {
+		return
+	}
+	pUser.LastSeen = time.Now()
+	counter.InProgress[userID] = pUser
 }
 
 func (counter *TimeCounter) EndGametime(pUser PlayingUser) {
-	// Delete user from playing list
+	counter.mu.Lock()
 	delete(counter.InProgress, pUser.UserID)
+	counter.mu.Unlock()
 
-	// Update game time
-	err := counter.GametimeDB.Update(func(t *bolt.Tx) error {
-		err := pUser.SaveGametime(t)
-		return err
-	})
-
-	if err != nil {
+	if err := counter.Store.EndSession(pUser.UserID, pUser.GameID, pUser.StartTime, time.Now()); err != nil {
 		log.Printf("Error while updating game time : %s", err.Error())
+		return
 	}
 
 	log.Printf("Saved %s", pUser.UserID)
 }
 
 func (counter *TimeCounter) GetUserGametime(user discord.User) (map[string]int64, error) {
-	gameMap := make(map[string]int64)
-	err := counter.GametimeDB.View(func(t *bolt.Tx) error {
-		b := t.Bucket([]byte(user.ID))
-		if b == nil {
-			return errors.New("user never played")
-		}
-		// Iterate through all games
-		b.ForEach(func(gameID []byte, nanoTime []byte) error {
-			gameMap[string(gameID[:])], _ = binary.Varint(nanoTime)
-			return nil
-		})
-		return nil
-	})
-	return gameMap, err
+	return counter.Store.UserGametime(user.ID)
+}
+
+// Playing reports whether userID has an in-progress session, returning a
+// copy of it if so.
+func (counter *TimeCounter) Playing(userID string) (PlayingUser, bool) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	pUser, ok := counter.InProgress[userID]
+	return pUser, ok
+}
+
+// Sessions returns a snapshot of every in-progress session, safe to range
+// over without racing concurrent writers to InProgress.
+func (counter *TimeCounter) Sessions() []PlayingUser {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	sessions := make([]PlayingUser, 0, len(counter.InProgress))
+	for _, pUser := range counter.InProgress {
+		sessions = append(sessions, pUser)
+	}
+	return sessions
 }
 
+// Snapshot flushes every in-progress session's elapsed time to the store
+// without ending the session, so restarts don't lose partial playtime.
 func (counter *TimeCounter) Snapshot() error {
-	return counter.GametimeDB.Update(func(t *bolt.Tx) (err error) {
-		for _, pUser := range counter.InProgress {
-			err = pUser.SaveGametime(t)
-			if err != nil {
-				log.Print(err)
-				continue
-			}
-		}
-		log.Print("Snapshot done")
-		return nil
-	})
+	counter.mu.Lock()
+	inProgress := make(map[string]PlayingUser, len(counter.InProgress))
+	for id, pUser := range counter.InProgress {
+		inProgress[id] = pUser
+	}
+	counter.mu.Unlock()
+
+	if err := counter.Store.SnapshotAll(context.Background(), inProgress); err != nil {
+		log.Print(err)
+		return err
+	}
+
+	// Reset start times so the next snapshot/end only counts time since now.
+	now := time.Now()
+	counter.mu.Lock()
+	for id, pUser := range counter.InProgress {
+		pUser.StartTime = now
+		counter.InProgress[id] = pUser
+	}
+	counter.mu.Unlock()
+
+	log.Print("Snapshot done")
+	return nil
 }
 
 func (counter *TimeCounter) Close() {
@@ -148,5 +196,7 @@ func (counter *TimeCounter) Close() {
 	if err := counter.Snapshot(); err != nil {
 		log.Print(err)
 	}
-	counter.GametimeDB.Close()
-}
\ No newline at end of file
+	if err := counter.Store.Close(); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdraynz/go-discord/discord"
+)
+
+// leaderboardSize caps how many ranked entries top/server ever show.
+const leaderboardSize = 10
+
+// leaderboardText formats ranked leaderboard entries into a plain-text
+// reply, one line per entry, in the order given. Plain text rather than
+// an embed, since neither discord.Embed nor client.SendEmbed are proven
+// to exist on the real gdraynz/go-discord dependency this repo can't
+// vendor or fork.
+func leaderboardText(title string, entries []LeaderboardEntry) string {
+	if len(entries) == 0 {
+		return fmt.Sprintf("%s\nNobody's logged any playtime yet.", title)
+	}
+	text := title + "\n"
+	for i, e := range entries {
+		text += fmt.Sprintf("#%d <@%s> -- %s\n", i+1, e.UserID, getDurationString(time.Duration(e.Nanos)))
+	}
+	return text
+}
+
+// topCmd implements "!go top [game]": the global leaderboard for a
+// single game, or (with no game given) overall across every game anyone's
+// been tracked playing.
+type topCmd struct{}
+
+func (topCmd) Help() string {
+	return "Shows the playtime leaderboard for <game>, or overall if omitted"
+}
+func (topCmd) Usage() string { return "top [game]" }
+
+func (topCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	title := "Top players overall"
+
+	var gameID string
+	if len(args) > 0 {
+		gameName := strings.Join(args, " ")
+		id, found := gameIDByName(gameName)
+		if !found {
+			return nil, fmt.Errorf("don't know a game called '%s'", gameName)
+		}
+		gameID = id
+		title = fmt.Sprintf("Top players for %s", gameName)
+	}
+
+	entries, err := counter.Store.LeaderboardByGame(gameID, leaderboardSize)
+	if err != nil {
+		return nil, err
+	}
+	return leaderboardText(title, entries), nil
+}
+
+// serverCmd implements "!go server": the playtime leaderboard restricted
+// to this guild's own members, since LeaderboardByGame ranks across every
+// server the bot is in.
+type serverCmd struct{}
+
+func (serverCmd) Help() string  { return "Shows the playtime leaderboard for this server's members" }
+func (serverCmd) Usage() string { return "server" }
+
+func (serverCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	server := msg.GetServer(&client)
+
+	memberIDs := make([]string, len(server.Members))
+	for i, member := range server.Members {
+		memberIDs[i] = member.ID
+	}
+
+	entries, err := counter.Store.TotalByUsers(memberIDs)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Nanos > entries[j].Nanos })
+	if len(entries) > leaderboardSize {
+		entries = entries[:leaderboardSize]
+	}
+
+	return leaderboardText(fmt.Sprintf("Top players in %s", server.Name), entries), nil
+}
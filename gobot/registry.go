@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdraynz/go-discord/discord"
+)
+
+// Command is a typed bot command. Usage/Help describe it for the `help`
+// listing; Run executes it against the words following the command name
+// and returns a reply to send back.
+//
+// A string reply sends a plain message, and a nil reply means the
+// command already replied itself (or has nothing to say). Any other
+// type is a bug and gets logged rather than silently dropped.
+type Command interface {
+	Help() string
+	Usage() string
+	Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error)
+}
+
+// CommandRegistry holds commands by the word that invokes them and
+// dispatches incoming "!go <word> ..." messages to the right one. It
+// replaces the old flat commands map[string]Command + hand-rolled
+// helpCommand: commands now own their own argument parsing and usage
+// text, so help stays in sync with them automatically.
+type CommandRegistry struct {
+	commands map[string]Command
+	order    []string // registration order, so help lists commands predictably
+}
+
+// NewCommandRegistry returns an empty registry ready for Register calls.
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{commands: make(map[string]Command)}
+}
+
+// Register adds cmd under word, overwriting any command already there.
+func (r *CommandRegistry) Register(word string, cmd Command) {
+	if _, exists := r.commands[word]; !exists {
+		r.order = append(r.order, word)
+	}
+	r.commands[word] = cmd
+}
+
+// Dispatch routes an incoming message to its command, if any, and sends
+// back whatever the command returns.
+func (r *CommandRegistry) Dispatch(message discord.Message) {
+	if !strings.HasPrefix(message.Content, "!go") {
+		return
+	}
+
+	args := strings.Split(message.Content, " ")
+	if len(args)-1 < 1 {
+		return
+	}
+	totalCommands++
+
+	word := args[1]
+	cmd, ok := r.commands[word]
+	if !ok {
+		log.Printf("No command '%s'", word)
+		return
+	}
+
+	reply, err := cmd.Run(context.Background(), args[2:], message)
+	if err != nil {
+		client.SendMessage(message.ChannelID, fmt.Sprintf("`%s`: %s", word, err.Error()))
+		return
+	}
+
+	switch v := reply.(type) {
+	case nil:
+	case string:
+		client.SendMessage(message.ChannelID, v)
+	default:
+		log.Printf("Command '%s' returned unsupported reply type %T", word, reply)
+	}
+}
+
+// HelpText builds the `help` reply: one line per registered command, in
+// registration order. Plain text rather than an embed, since neither
+// discord.Embed nor client.SendEmbed are proven to exist on the real
+// gdraynz/go-discord dependency this repo can't vendor or fork.
+func (r *CommandRegistry) HelpText() string {
+	text := "Available commands (prefix every command with `!go`):\n"
+	for _, word := range r.order {
+		cmd := r.commands[word]
+		text += fmt.Sprintf("`%s` -- %s\n", cmd.Usage(), cmd.Help())
+	}
+	return text
+}
+
+// parseArgs fills dst's tagged fields from args, one field per word in
+// struct declaration order. A field is declared positional by an
+// `arg:"name"` tag; `arg:"name,rest"` instead slurps every remaining
+// word (space-joined) into a string field, letting a command declare
+// something like "reminder <duration> [message...]" directly on its
+// struct. Supported field types are string, int and time.Duration.
+func parseArgs(dst interface{}, args []string) error {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+
+	i := 0
+	for f := 0; f < t.NumField(); f++ {
+		field := t.Field(f)
+		tag := field.Tag.Get("arg")
+		if tag == "" {
+			continue
+		}
+
+		name, rest := tag, false
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, rest = tag[:idx], tag[idx+1:] == "rest"
+		}
+
+		if rest {
+			if i < len(args) {
+				v.Field(f).SetString(strings.Join(args[i:], " "))
+				i = len(args)
+			}
+			continue
+		}
+
+		if i >= len(args) {
+			return fmt.Errorf("missing argument <%s>", name)
+		}
+
+		switch field.Type {
+		case reflect.TypeOf(time.Duration(0)):
+			d, err := time.ParseDuration(args[i])
+			if err != nil {
+				return fmt.Errorf("couldn't parse <%s>: %s", name, err.Error())
+			}
+			v.Field(f).SetInt(int64(d))
+		default:
+			switch v.Field(f).Kind() {
+			case reflect.String:
+				v.Field(f).SetString(args[i])
+			case reflect.Int, reflect.Int64:
+				n, err := strconv.Atoi(args[i])
+				if err != nil {
+					return fmt.Errorf("couldn't parse <%s>: %s", name, err.Error())
+				}
+				v.Field(f).SetInt(int64(n))
+			default:
+				return fmt.Errorf("unsupported arg field type %s for <%s>", v.Field(f).Kind(), name)
+			}
+		}
+		i++
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// LeaderboardEntry is one ranked row returned by LeaderboardByGame: a user
+// and the total time (in nanoseconds) they've logged for the queried game.
+type LeaderboardEntry struct {
+	UserID string
+	Nanos  int64
+}
+
+// GametimeStore persists playtime sessions behind a swappable backend.
+// TimeCounter drives it; the bolt, sql and badger implementations are
+// interchangeable at startup via the -store flag.
+type GametimeStore interface {
+	// StartSession records that userID began playing gameID at start.
+	// Backends that only persist totals may treat this as a no-op.
+	StartSession(userID, gameID string, start time.Time) error
+
+	// EndSession closes out a session, adding (end - start) to the user's
+	// running total for gameID.
+	EndSession(userID, gameID string, start, end time.Time) error
+
+	// SnapshotAll flushes every still-running session in inProgress without
+	// ending it, so a SIGTERM mid-session doesn't lose the partial time.
+	SnapshotAll(ctx context.Context, inProgress map[string]PlayingUser) error
+
+	// UserGametime returns gameID -> total nanoseconds played for a user.
+	UserGametime(userID string) (map[string]int64, error)
+
+	// LeaderboardByGame returns the top n users for gameID ordered by total
+	// time played, descending. An empty gameID aggregates across all games.
+	LeaderboardByGame(gameID string, n int) ([]LeaderboardEntry, error)
+
+	// TotalByUsers returns each of userIDs' total logged time across every
+	// game, as LeaderboardEntry{UserID, Nanos}; users with no logged time
+	// are omitted. Used by "!go server" to rank a guild's own members in
+	// one query instead of one per member.
+	TotalByUsers(userIDs []string) ([]LeaderboardEntry, error)
+
+	// SaveWatch persists a watch so it survives a restart.
+	SaveWatch(w Watch) error
+
+	// RemoveWatch deletes a previously saved watch. It is not an error to
+	// remove a watch that doesn't exist.
+	RemoveWatch(w Watch) error
+
+	// WatchesForTarget returns every watch whose TargetID is targetID.
+	WatchesForTarget(targetID string) ([]Watch, error)
+
+	// SetAnnounceChannel records the channel a guild wants game-start
+	// announcements posted to.
+	SetAnnounceChannel(guildID, channelID string) error
+
+	// AnnounceChannel returns the channel previously set for guildID, or
+	// "" if none was configured.
+	AnnounceChannel(guildID string) (string, error)
+
+	Close() error
+}
+
+// Watch records that WatcherID wants to be told when TargetID starts
+// playing GameID. An empty GameID means "any game". ChannelID is the
+// channel the watch was registered from, and is where Notify posts the
+// mention -- the bot has no proven way to DM a user directly.
+type Watch struct {
+	WatcherID string
+	TargetID  string
+	GameID    string
+	ChannelID string
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// BadgerStore is a fast embedded key/value backend for single-host
+// deployments that don't need Bolt's single-writer-transaction model.
+// Gametime totals live under "gt/<userID>/<gameID>" as little-endian
+// uint64 nanoseconds; watches and announce channels get their own
+// prefixes so a full-table scan (LeaderboardByGame) only ever sees
+// gametime keys.
+type BadgerStore struct {
+	db *badger.DB
+}
+
+const (
+	gametimePrefix = "gt/"
+	watchPrefix    = "watch/"
+	channelPrefix  = "channel/"
+)
+
+// NewBadgerStore opens (creating if necessary) a Badger database in dir.
+func NewBadgerStore(dir string) (*BadgerStore, error) {
+	opts := badger.DefaultOptions(dir)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BadgerStore{db: db}, nil
+}
+
+func badgerKey(userID, gameID string) []byte {
+	return []byte(gametimePrefix + userID + "/" + gameID)
+}
+
+func (s *BadgerStore) StartSession(userID, gameID string, start time.Time) error {
+	return nil
+}
+
+func (s *BadgerStore) EndSession(userID, gameID string, start, end time.Time) error {
+	return s.addGametime(userID, gameID, end.Sub(start))
+}
+
+func (s *BadgerStore) addGametime(userID, gameID string, elapsed time.Duration) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		var total uint64
+		item, err := txn.Get(badgerKey(userID, gameID))
+		if err == nil {
+			if err := item.Value(func(val []byte) error {
+				total = binary.LittleEndian.Uint64(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		total += uint64(elapsed.Nanoseconds())
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, total)
+		return txn.Set(badgerKey(userID, gameID), buf)
+	})
+}
+
+func (s *BadgerStore) SnapshotAll(ctx context.Context, inProgress map[string]PlayingUser) error {
+	now := time.Now()
+	for _, pUser := range inProgress {
+		if err := s.addGametime(pUser.UserID, pUser.GameID, now.Sub(pUser.StartTime)); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *BadgerStore) UserGametime(userID string) (map[string]int64, error) {
+	gameMap := make(map[string]int64)
+	prefix := []byte(gametimePrefix + userID + "/")
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			key := string(it.Item().Key()[len(prefix):])
+			if err := it.Item().Value(func(val []byte) error {
+				gameMap[key] = int64(binary.LittleEndian.Uint64(val))
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return gameMap, err
+}
+
+func (s *BadgerStore) LeaderboardByGame(gameID string, n int) ([]LeaderboardEntry, error) {
+	totals := make(map[string]int64)
+	prefix := []byte(gametimePrefix)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			key := string(it.Item().Key()[len(prefix):])
+			userID, keyGameID := splitBadgerKey(key)
+			if gameID != "" && keyGameID != gameID {
+				continue
+			}
+			err := it.Item().Value(func(val []byte) error {
+				totals[userID] += int64(binary.LittleEndian.Uint64(val))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(totals))
+	for userID, nanos := range totals {
+		entries = append(entries, LeaderboardEntry{UserID: userID, Nanos: nanos})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Nanos > entries[j].Nanos })
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+func (s *BadgerStore) TotalByUsers(userIDs []string) ([]LeaderboardEntry, error) {
+	entries := make([]LeaderboardEntry, 0, len(userIDs))
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, userID := range userIDs {
+			total, err := totalForUser(txn, userID)
+			if err != nil {
+				return err
+			}
+			if total > 0 {
+				entries = append(entries, LeaderboardEntry{UserID: userID, Nanos: total})
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func totalForUser(txn *badger.Txn, userID string) (int64, error) {
+	var total int64
+	prefix := []byte(gametimePrefix + userID + "/")
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		err := it.Item().Value(func(val []byte) error {
+			total += int64(binary.LittleEndian.Uint64(val))
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+func splitBadgerKey(key string) (userID, gameID string) {
+	for i := len(key) - 1; i >= 0; i-- {
+		if key[i] == '/' {
+			return key[:i], key[i+1:]
+		}
+	}
+	return key, ""
+}
+
+func watchBadgerKey(w Watch) []byte {
+	return []byte(watchPrefix + w.WatcherID + "/" + w.TargetID + "/" + w.GameID)
+}
+
+func (s *BadgerStore) SaveWatch(w Watch) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(watchBadgerKey(w), []byte(w.ChannelID))
+	})
+}
+
+func (s *BadgerStore) RemoveWatch(w Watch) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(watchBadgerKey(w))
+	})
+}
+
+func (s *BadgerStore) WatchesForTarget(targetID string) ([]Watch, error) {
+	var watches []Watch
+	prefix := []byte(watchPrefix)
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			key := string(item.Key()[len(prefix):])
+			w, ok := parseWatchBadgerKey(key)
+			if !ok || w.TargetID != targetID {
+				continue
+			}
+			if err := item.Value(func(val []byte) error {
+				w.ChannelID = string(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+			watches = append(watches, w)
+		}
+		return nil
+	})
+	return watches, err
+}
+
+func parseWatchBadgerKey(key string) (Watch, bool) {
+	parts := make([]string, 0, 3)
+	start := 0
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' {
+			parts = append(parts, key[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, key[start:])
+	if len(parts) != 3 {
+		return Watch{}, false
+	}
+	return Watch{WatcherID: parts[0], TargetID: parts[1], GameID: parts[2]}, true
+}
+
+func (s *BadgerStore) SetAnnounceChannel(guildID, channelID string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(channelPrefix+guildID), []byte(channelID))
+	})
+}
+
+func (s *BadgerStore) AnnounceChannel(guildID string) (string, error) {
+	var channelID string
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(channelPrefix + guildID))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			channelID = string(val)
+			return nil
+		})
+	})
+	return channelID, err
+}
+
+func (s *BadgerStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	gametimeBucket = []byte("gametime")
+	watchBucket    = []byte("watches")
+	channelBucket  = []byte("channels")
+)
+
+// BoltStore is the original single-process backend: a "gametime" bucket
+// holding one sub-bucket per user (keyed by game ID, holding a
+// varint-encoded nanosecond total), plus flat "watches" and "channels"
+// buckets for the watch subsystem.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a BoltDB file at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(t *bolt.Tx) error {
+		if _, err := t.CreateBucketIfNotExists(gametimeBucket); err != nil {
+			return err
+		}
+		if _, err := t.CreateBucketIfNotExists(watchBucket); err != nil {
+			return err
+		}
+		_, err := t.CreateBucketIfNotExists(channelBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) StartSession(userID, gameID string, start time.Time) error {
+	// Bolt only persists totals; the running session lives in
+	// TimeCounter.InProgress until it ends or is snapshotted.
+	return nil
+}
+
+func (s *BoltStore) EndSession(userID, gameID string, start, end time.Time) error {
+	return s.db.Update(func(t *bolt.Tx) error {
+		return addGametime(t, userID, gameID, end.Sub(start))
+	})
+}
+
+func (s *BoltStore) SnapshotAll(ctx context.Context, inProgress map[string]PlayingUser) error {
+	return s.db.Update(func(t *bolt.Tx) error {
+		now := time.Now()
+		for _, pUser := range inProgress {
+			if err := addGametime(t, pUser.UserID, pUser.GameID, now.Sub(pUser.StartTime)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func addGametime(t *bolt.Tx, userID, gameID string, elapsed time.Duration) error {
+	users := t.Bucket(gametimeBucket)
+	b, err := users.CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	if bPlayed := b.Get([]byte(gameID)); bPlayed != nil {
+		played, _ := binary.Varint(bPlayed)
+		total = played
+	}
+	total += elapsed.Nanoseconds()
+
+	newPlayed := make([]byte, binary.MaxVarintLen64)
+	binary.PutVarint(newPlayed, total)
+	return b.Put([]byte(gameID), newPlayed)
+}
+
+func (s *BoltStore) UserGametime(userID string) (map[string]int64, error) {
+	gameMap := make(map[string]int64)
+	err := s.db.View(func(t *bolt.Tx) error {
+		b := t.Bucket(gametimeBucket).Bucket([]byte(userID))
+		if b == nil {
+			return errors.New("user never played")
+		}
+		return b.ForEach(func(gameID []byte, nanoTime []byte) error {
+			gameMap[string(gameID)], _ = binary.Varint(nanoTime)
+			return nil
+		})
+	})
+	return gameMap, err
+}
+
+func (s *BoltStore) LeaderboardByGame(gameID string, n int) ([]LeaderboardEntry, error) {
+	var entries []LeaderboardEntry
+	err := s.db.View(func(t *bolt.Tx) error {
+		return t.Bucket(gametimeBucket).ForEach(func(userID []byte, _ []byte) error {
+			b := t.Bucket(gametimeBucket).Bucket(userID)
+			if b == nil {
+				return nil
+			}
+			if gameID == "" {
+				var total int64
+				b.ForEach(func(_ []byte, nanoTime []byte) error {
+					nanos, _ := binary.Varint(nanoTime)
+					total += nanos
+					return nil
+				})
+				if total > 0 {
+					entries = append(entries, LeaderboardEntry{UserID: string(userID), Nanos: total})
+				}
+				return nil
+			}
+			if nanoTime := b.Get([]byte(gameID)); nanoTime != nil {
+				nanos, _ := binary.Varint(nanoTime)
+				entries = append(entries, LeaderboardEntry{UserID: string(userID), Nanos: nanos})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Nanos > entries[j].Nanos })
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+func (s *BoltStore) TotalByUsers(userIDs []string) ([]LeaderboardEntry, error) {
+	entries := make([]LeaderboardEntry, 0, len(userIDs))
+	err := s.db.View(func(t *bolt.Tx) error {
+		for _, userID := range userIDs {
+			b := t.Bucket(gametimeBucket).Bucket([]byte(userID))
+			if b == nil {
+				continue
+			}
+			var total int64
+			err := b.ForEach(func(_ []byte, nanoTime []byte) error {
+				nanos, _ := binary.Varint(nanoTime)
+				total += nanos
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if total > 0 {
+				entries = append(entries, LeaderboardEntry{UserID: userID, Nanos: total})
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// watchKey builds the flat key a watch is stored under: watches are rare
+// enough that a linear scan in WatchesForTarget is fine, so there's no
+// need for a secondary index on TargetID.
+func watchKey(w Watch) []byte {
+	return []byte(w.WatcherID + "\x00" + w.TargetID + "\x00" + w.GameID)
+}
+
+func (s *BoltStore) SaveWatch(w Watch) error {
+	return s.db.Update(func(t *bolt.Tx) error {
+		return t.Bucket(watchBucket).Put(watchKey(w), []byte(w.ChannelID))
+	})
+}
+
+func (s *BoltStore) RemoveWatch(w Watch) error {
+	return s.db.Update(func(t *bolt.Tx) error {
+		return t.Bucket(watchBucket).Delete(watchKey(w))
+	})
+}
+
+func (s *BoltStore) WatchesForTarget(targetID string) ([]Watch, error) {
+	var watches []Watch
+	err := s.db.View(func(t *bolt.Tx) error {
+		return t.Bucket(watchBucket).ForEach(func(key []byte, channelID []byte) error {
+			w, err := parseWatchKey(string(key))
+			if err != nil {
+				return err
+			}
+			if w.TargetID == targetID {
+				w.ChannelID = string(channelID)
+				watches = append(watches, w)
+			}
+			return nil
+		})
+	})
+	return watches, err
+}
+
+func parseWatchKey(key string) (Watch, error) {
+	parts := make([]string, 0, 3)
+	start := 0
+	for i := 0; i < len(key); i++ {
+		if key[i] == 0 {
+			parts = append(parts, key[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, key[start:])
+	if len(parts) != 3 {
+		return Watch{}, errors.New("malformed watch key")
+	}
+	return Watch{WatcherID: parts[0], TargetID: parts[1], GameID: parts[2]}, nil
+}
+
+func (s *BoltStore) SetAnnounceChannel(guildID, channelID string) error {
+	return s.db.Update(func(t *bolt.Tx) error {
+		return t.Bucket(channelBucket).Put([]byte(guildID), []byte(channelID))
+	})
+}
+
+func (s *BoltStore) AnnounceChannel(guildID string) (string, error) {
+	var channelID string
+	err := s.db.View(func(t *bolt.Tx) error {
+		channelID = string(t.Bucket(channelBucket).Get([]byte(guildID)))
+		return nil
+	})
+	return channelID, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLStore is a database/sql backed GametimeStore. It speaks plain SQL so
+// the same code path serves both the "sqlite" driver (single host, zero
+// ops) and "postgres" (shared state across shards).
+type SQLStore struct {
+	db     *sql.DB
+	driver string
+}
+
+const sqlSchema = `
+CREATE TABLE IF NOT EXISTS gametime (
+	user_id TEXT NOT NULL,
+	game_id TEXT NOT NULL,
+	nanos   BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (user_id, game_id)
+);
+CREATE TABLE IF NOT EXISTS watches (
+	watcher_id TEXT NOT NULL,
+	target_id  TEXT NOT NULL,
+	game_id    TEXT NOT NULL DEFAULT '',
+	channel_id TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (watcher_id, target_id, game_id)
+);
+CREATE TABLE IF NOT EXISTS guild_channels (
+	guild_id   TEXT NOT NULL PRIMARY KEY,
+	channel_id TEXT NOT NULL
+)`
+
+// NewSQLStore opens a database via driver (expected to be "sqlite3" or
+// "postgres") using dsn, runs migrations, and returns a ready store.
+func NewSQLStore(driver, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqlSchema); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db, driver: driver}, nil
+}
+
+// placeholder returns the driver-specific bind parameter for the i-th
+// (1-indexed) argument in a query.
+func (s *SQLStore) placeholder(i int) string {
+	if s.driver == "postgres" {
+		return fmt.Sprintf("$%d", i)
+	}
+	return "?"
+}
+
+func (s *SQLStore) StartSession(userID, gameID string, start time.Time) error {
+	return nil
+}
+
+func (s *SQLStore) EndSession(userID, gameID string, start, end time.Time) error {
+	return s.addGametime(userID, gameID, end.Sub(start))
+}
+
+func (s *SQLStore) addGametime(userID, gameID string, elapsed time.Duration) error {
+	var query string
+	switch s.driver {
+	case "postgres":
+		query = `INSERT INTO gametime (user_id, game_id, nanos) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, game_id) DO UPDATE SET nanos = gametime.nanos + $3`
+	default:
+		query = `INSERT INTO gametime (user_id, game_id, nanos) VALUES (?, ?, ?)
+			ON CONFLICT (user_id, game_id) DO UPDATE SET nanos = nanos + ?`
+		_, err := s.db.Exec(query, userID, gameID, elapsed.Nanoseconds(), elapsed.Nanoseconds())
+		return err
+	}
+	_, err := s.db.Exec(query, userID, gameID, elapsed.Nanoseconds())
+	return err
+}
+
+func (s *SQLStore) SnapshotAll(ctx context.Context, inProgress map[string]PlayingUser) error {
+	now := time.Now()
+	for _, pUser := range inProgress {
+		if err := s.addGametime(pUser.UserID, pUser.GameID, now.Sub(pUser.StartTime)); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) UserGametime(userID string) (map[string]int64, error) {
+	rows, err := s.db.Query(`SELECT game_id, nanos FROM gametime WHERE user_id = `+s.placeholder(1), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gameMap := make(map[string]int64)
+	for rows.Next() {
+		var gameID string
+		var nanos int64
+		if err := rows.Scan(&gameID, &nanos); err != nil {
+			return nil, err
+		}
+		gameMap[gameID] = nanos
+	}
+	return gameMap, rows.Err()
+}
+
+func (s *SQLStore) LeaderboardByGame(gameID string, n int) ([]LeaderboardEntry, error) {
+	var rows *sql.Rows
+	var err error
+	if gameID == "" {
+		rows, err = s.db.Query(
+			`SELECT user_id, SUM(nanos) AS total FROM gametime GROUP BY user_id ORDER BY total DESC LIMIT `+s.placeholder(1),
+			n,
+		)
+	} else {
+		rows, err = s.db.Query(
+			`SELECT user_id, nanos FROM gametime WHERE game_id = `+s.placeholder(1)+` ORDER BY nanos DESC LIMIT `+s.placeholder(2),
+			gameID, n,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var e LeaderboardEntry
+		if err := rows.Scan(&e.UserID, &e.Nanos); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLStore) TotalByUsers(userIDs []string) ([]LeaderboardEntry, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(userIDs))
+	args := make([]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		placeholders[i] = s.placeholder(i + 1)
+		args[i] = userID
+	}
+
+	rows, err := s.db.Query(
+		`SELECT user_id, SUM(nanos) AS total FROM gametime WHERE user_id IN (`+
+			strings.Join(placeholders, ", ")+`) GROUP BY user_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var e LeaderboardEntry
+		if err := rows.Scan(&e.UserID, &e.Nanos); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLStore) SaveWatch(w Watch) error {
+	var query string
+	if s.driver == "postgres" {
+		query = `INSERT INTO watches (watcher_id, target_id, game_id, channel_id) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (watcher_id, target_id, game_id) DO UPDATE SET channel_id = $4`
+	} else {
+		query = `INSERT OR REPLACE INTO watches (watcher_id, target_id, game_id, channel_id) VALUES (?, ?, ?, ?)`
+	}
+	_, err := s.db.Exec(query, w.WatcherID, w.TargetID, w.GameID, w.ChannelID)
+	return err
+}
+
+func (s *SQLStore) RemoveWatch(w Watch) error {
+	query := `DELETE FROM watches WHERE watcher_id = ` + s.placeholder(1) +
+		` AND target_id = ` + s.placeholder(2) + ` AND game_id = ` + s.placeholder(3)
+	_, err := s.db.Exec(query, w.WatcherID, w.TargetID, w.GameID)
+	return err
+}
+
+func (s *SQLStore) WatchesForTarget(targetID string) ([]Watch, error) {
+	rows, err := s.db.Query(
+		`SELECT watcher_id, target_id, game_id, channel_id FROM watches WHERE target_id = `+s.placeholder(1),
+		targetID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var watches []Watch
+	for rows.Next() {
+		var w Watch
+		if err := rows.Scan(&w.WatcherID, &w.TargetID, &w.GameID, &w.ChannelID); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+func (s *SQLStore) SetAnnounceChannel(guildID, channelID string) error {
+	var query string
+	if s.driver == "postgres" {
+		query = `INSERT INTO guild_channels (guild_id, channel_id) VALUES ($1, $2)
+			ON CONFLICT (guild_id) DO UPDATE SET channel_id = $2`
+	} else {
+		query = `INSERT INTO guild_channels (guild_id, channel_id) VALUES (?, ?)
+			ON CONFLICT (guild_id) DO UPDATE SET channel_id = excluded.channel_id`
+	}
+	_, err := s.db.Exec(query, guildID, channelID)
+	return err
+}
+
+func (s *SQLStore) AnnounceChannel(guildID string) (string, error) {
+	var channelID string
+	err := s.db.QueryRow(
+		`SELECT channel_id FROM guild_channels WHERE guild_id = `+s.placeholder(1),
+		guildID,
+	).Scan(&channelID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return channelID, err
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
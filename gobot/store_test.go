@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+// memWatchKey identifies a watch without its ChannelID, mirroring how
+// the real backends key a watch (the channel is stored as the value, not
+// part of the key) so Unwatch matches regardless of which channel the
+// original watch was posted from.
+type memWatchKey struct {
+	WatcherID, TargetID, GameID string
+}
+
+// memStore is a minimal in-memory GametimeStore used only by tests, so
+// TimeCounter logic can be exercised without a real bolt/sql/badger backend.
+type memStore struct {
+	totals   map[string]map[string]int64
+	watches  map[memWatchKey]string
+	channels map[string]string
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		totals:   make(map[string]map[string]int64),
+		watches:  make(map[memWatchKey]string),
+		channels: make(map[string]string),
+	}
+}
+
+func (m *memStore) StartSession(userID, gameID string, start time.Time) error {
+	return nil
+}
+
+func (m *memStore) EndSession(userID, gameID string, start, end time.Time) error {
+	if m.totals[userID] == nil {
+		m.totals[userID] = make(map[string]int64)
+	}
+	m.totals[userID][gameID] += end.Sub(start).Nanoseconds()
+	return nil
+}
+
+func (m *memStore) SnapshotAll(ctx context.Context, inProgress map[string]PlayingUser) error {
+	now := time.Now()
+	for _, pUser := range inProgress {
+		if err := m.EndSession(pUser.UserID, pUser.GameID, pUser.StartTime, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memStore) UserGametime(userID string) (map[string]int64, error) {
+	return m.totals[userID], nil
+}
+
+func (m *memStore) LeaderboardByGame(gameID string, n int) ([]LeaderboardEntry, error) {
+	var entries []LeaderboardEntry
+	for userID, games := range m.totals {
+		if gameID == "" {
+			var total int64
+			for _, nanos := range games {
+				total += nanos
+			}
+			entries = append(entries, LeaderboardEntry{UserID: userID, Nanos: total})
+			continue
+		}
+		if nanos, ok := games[gameID]; ok {
+			entries = append(entries, LeaderboardEntry{UserID: userID, Nanos: nanos})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Nanos > entries[j].Nanos })
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+func (m *memStore) TotalByUsers(userIDs []string) ([]LeaderboardEntry, error) {
+	entries := make([]LeaderboardEntry, 0, len(userIDs))
+	for _, userID := range userIDs {
+		var total int64
+		for _, nanos := range m.totals[userID] {
+			total += nanos
+		}
+		if total > 0 {
+			entries = append(entries, LeaderboardEntry{UserID: userID, Nanos: total})
+		}
+	}
+	return entries, nil
+}
+
+func (m *memStore) SaveWatch(w Watch) error {
+	m.watches[memWatchKey{w.WatcherID, w.TargetID, w.GameID}] = w.ChannelID
+	return nil
+}
+
+func (m *memStore) RemoveWatch(w Watch) error {
+	delete(m.watches, memWatchKey{w.WatcherID, w.TargetID, w.GameID})
+	return nil
+}
+
+func (m *memStore) WatchesForTarget(targetID string) ([]Watch, error) {
+	var watches []Watch
+	for k, channelID := range m.watches {
+		if k.TargetID == targetID {
+			watches = append(watches, Watch{WatcherID: k.WatcherID, TargetID: k.TargetID, GameID: k.GameID, ChannelID: channelID})
+		}
+	}
+	return watches, nil
+}
+
+func (m *memStore) SetAnnounceChannel(guildID, channelID string) error {
+	m.channels[guildID] = channelID
+	return nil
+}
+
+func (m *memStore) AnnounceChannel(guildID string) (string, error) {
+	return m.channels[guildID], nil
+}
+
+func (m *memStore) Close() error { return nil }
+
+func TestTimeCounterStartEndGametime(t *testing.T) {
+	counter, err := NewCounter(newMemStore(), DefaultIdleTimeout)
+	if err != nil {
+		t.Fatalf("NewCounter: %s", err)
+	}
+
+	pUser := PlayingUser{UserID: "u1", GameID: "42", StartTime: time.Now().Add(-time.Minute)}
+	counter.InProgress[pUser.UserID] = pUser
+
+	counter.EndGametime(pUser)
+
+	if _, ok := counter.InProgress[pUser.UserID]; ok {
+		t.Fatal("expected user to be removed from InProgress after EndGametime")
+	}
+
+	gameTime, err := counter.Store.UserGametime("u1")
+	if err != nil {
+		t.Fatalf("UserGametime: %s", err)
+	}
+	if gameTime["42"] <= 0 {
+		t.Fatalf("expected recorded playtime for game 42, got %d", gameTime["42"])
+	}
+}
+
+func TestTimeCounterSnapshot(t *testing.T) {
+	counter, err := NewCounter(newMemStore(), DefaultIdleTimeout)
+	if err != nil {
+		t.Fatalf("NewCounter: %s", err)
+	}
+
+	counter.InProgress["u1"] = PlayingUser{UserID: "u1", GameID: "7", StartTime: time.Now().Add(-30 * time.Second)}
+
+	if err := counter.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %s", err)
+	}
+
+	if _, ok := counter.InProgress["u1"]; !ok {
+		t.Fatal("Snapshot should not end the in-progress session")
+	}
+
+	gameTime, err := counter.Store.UserGametime("u1")
+	if err != nil {
+		t.Fatalf("UserGametime: %s", err)
+	}
+	if gameTime["7"] <= 0 {
+		t.Fatalf("expected snapshot to persist elapsed time, got %d", gameTime["7"])
+	}
+}
+
+func TestTimeCounterKickIdle(t *testing.T) {
+	counter, err := NewCounter(newMemStore(), time.Minute)
+	if err != nil {
+		t.Fatalf("NewCounter: %s", err)
+	}
+
+	counter.InProgress["stale"] = PlayingUser{
+		UserID:    "stale",
+		GameID:    "1",
+		StartTime: time.Now().Add(-3 * time.Hour),
+		LastSeen:  time.Now().Add(-2 * time.Hour),
+	}
+	counter.InProgress["fresh"] = PlayingUser{
+		UserID:    "fresh",
+		GameID:    "1",
+		StartTime: time.Now().Add(-time.Hour),
+		LastSeen:  time.Now(),
+	}
+
+	counter.kickIdle()
+
+	if _, ok := counter.InProgress["stale"]; ok {
+		t.Fatal("expected the idle session to be kicked")
+	}
+	if _, ok := counter.InProgress["fresh"]; !ok {
+		t.Fatal("expected the active session to stay in progress")
+	}
+
+	gameTime, err := counter.Store.UserGametime("stale")
+	if err != nil {
+		t.Fatalf("UserGametime: %s", err)
+	}
+	if gameTime["1"] <= 0 {
+		t.Fatalf("expected the kicked session's playtime to be saved, got %d", gameTime["1"])
+	}
+}
+
+func TestTimeCounterTouch(t *testing.T) {
+	counter, err := NewCounter(newMemStore(), DefaultIdleTimeout)
+	if err != nil {
+		t.Fatalf("NewCounter: %s", err)
+	}
+
+	lastSeen := time.Now().Add(-time.Hour)
+	counter.InProgress["u1"] = PlayingUser{UserID: "u1", GameID: "1", StartTime: lastSeen, LastSeen: lastSeen}
+
+	counter.Touch("u1")
+
+	if !counter.InProgress["u1"].LastSeen.After(lastSeen) {
+		t.Fatal("expected Touch to bump LastSeen")
+	}
+}
+
+func TestMemStoreTotalByUsers(t *testing.T) {
+	store := newMemStore()
+
+	if err := store.EndSession("u1", "7", time.Now().Add(-time.Minute), time.Now()); err != nil {
+		t.Fatalf("EndSession: %s", err)
+	}
+	if err := store.EndSession("u1", "8", time.Now().Add(-2*time.Minute), time.Now()); err != nil {
+		t.Fatalf("EndSession: %s", err)
+	}
+
+	entries, err := store.TotalByUsers([]string{"u1", "u2"})
+	if err != nil {
+		t.Fatalf("TotalByUsers: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only u1 to have logged time, got %d entries", len(entries))
+	}
+	if entries[0].UserID != "u1" {
+		t.Fatalf("expected u1, got %s", entries[0].UserID)
+	}
+	total := time.Duration(entries[0].Nanos)
+	if total < 3*time.Minute-time.Second || total > 3*time.Minute+time.Second {
+		t.Fatalf("expected total around 3m, got %s", total)
+	}
+}
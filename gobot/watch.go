@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdraynz/go-discord/discord"
+)
+
+// WatchRegistry notifies users when someone they're watching starts
+// playing a game, by @mentioning them in the channel each watch was
+// registered from and by posting to the watched user's guild's configured
+// announcement channel; no direct message is sent. It's a thin layer over
+// GametimeStore: watches and announce channels are written straight
+// through so both survive a restart.
+type WatchRegistry struct {
+	Store GametimeStore
+}
+
+// NewWatchRegistry wires a WatchRegistry to the given store.
+func NewWatchRegistry(store GametimeStore) *WatchRegistry {
+	return &WatchRegistry{Store: store}
+}
+
+// Watch records that watcherID wants to be told when targetID starts
+// playing gameID. An empty gameID means "any game". channelID is where
+// the watch command was issued, and is where Notify will post the
+// mention.
+func (r *WatchRegistry) Watch(watcherID, targetID, gameID, channelID string) error {
+	return r.Store.SaveWatch(Watch{WatcherID: watcherID, TargetID: targetID, GameID: gameID, ChannelID: channelID})
+}
+
+// Unwatch removes a previously registered watch.
+func (r *WatchRegistry) Unwatch(watcherID, targetID, gameID string) error {
+	return r.Store.RemoveWatch(Watch{WatcherID: watcherID, TargetID: targetID, GameID: gameID})
+}
+
+// Notify tells every watcher of user that they've just started playing
+// game: each watcher is @mentioned in the channel their watch was
+// registered from (no direct message is sent), and if user's guild has an announcement
+// channel configured, the start is also posted there. It's only called
+// from gameStarted's "new session" branch, so a dropped/duplicate
+// presence update for a session that's already in progress can't cause
+// a duplicate notification.
+func (r *WatchRegistry) Notify(client *discord.Client, user discord.User, game discord.Game) {
+	watches, err := r.Store.WatchesForTarget(user.ID)
+	if err != nil {
+		log.Printf("Error loading watches for %s: %s", user.Name, err.Error())
+		return
+	}
+
+	text := fmt.Sprintf("%s started playing %s", user.Name, game.Name)
+	gameID := strconv.Itoa(game.ID)
+
+	notified := make(map[string]bool, len(watches))
+	for _, w := range watches {
+		if w.GameID != "" && w.GameID != gameID {
+			continue
+		}
+		if notified[w.WatcherID] {
+			// Same watcher matched via both a "watch everything" and a
+			// game-specific entry for this target: only mention them once.
+			continue
+		}
+		notified[w.WatcherID] = true
+
+		watcher, ok := userByID(w.WatcherID)
+		if !ok {
+			log.Printf("Couldn't resolve watcher %s to a user", w.WatcherID)
+			continue
+		}
+		client.SendMessageMention(w.ChannelID, text, []discord.User{watcher})
+	}
+
+	server, ok := serverForUser(user.ID)
+	if !ok {
+		return
+	}
+	channelID, err := r.Store.AnnounceChannel(server.ID)
+	if err != nil {
+		log.Printf("Error loading announce channel for %s: %s", server.ID, err.Error())
+		return
+	}
+	if channelID != "" {
+		client.SendMessage(channelID, text)
+	}
+}
+
+// serverForUser finds the server userID is a member of, so a game-start
+// notification knows which guild's announcement channel to post to.
+func serverForUser(userID string) (discord.Server, bool) {
+	for _, server := range client.Servers {
+		for _, member := range server.Members {
+			if member.ID == userID {
+				return server, true
+			}
+		}
+	}
+	return discord.Server{}, false
+}
+
+// userByID finds the discord.User for id among every server the bot is
+// in, so Notify can @mention a watcher it's only ever stored an ID for.
+func userByID(id string) (discord.User, bool) {
+	for _, server := range client.Servers {
+		for _, member := range server.Members {
+			if member.ID == id {
+				return member, true
+			}
+		}
+	}
+	return discord.User{}, false
+}
+
+// resolveTargetUser finds the member server's arg refers to: either a
+// mention (<@id> or <@!id>) or a plain username.
+func resolveTargetUser(server discord.Server, arg string) (discord.User, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(arg, "<@!"), "<@"), ">")
+	for _, member := range server.Members {
+		if member.ID == id || member.Name == arg {
+			return member, true
+		}
+	}
+	return discord.User{}, false
+}
+
+// gameIDByName looks up a game by (case-insensitive) name, returning the
+// GameID string used by GametimeStore and Watch.
+func gameIDByName(name string) (string, bool) {
+	for _, game := range games {
+		if strings.EqualFold(game.Name, name) {
+			return strconv.Itoa(game.ID), true
+		}
+	}
+	return "", false
+}
+
+// resolveWatchArgs pulls the target user and optional game out of a
+// watch/unwatch command's args ([<user> [<game>...]]), which don't fit
+// parseArgs's one-field-per-word model since <user> needs server lookup.
+func resolveWatchArgs(server discord.Server, args []string) (target discord.User, gameID string, err error) {
+	if len(args) < 1 {
+		return discord.User{}, "", fmt.Errorf("usage: <user> [<game>]")
+	}
+
+	target, ok := resolveTargetUser(server, args[0])
+	if !ok {
+		return discord.User{}, "", fmt.Errorf("couldn't find user '%s'", args[0])
+	}
+
+	if len(args) < 2 {
+		return target, "", nil
+	}
+
+	gameName := strings.Join(args[1:], " ")
+	gameID, found := gameIDByName(gameName)
+	if !found {
+		return discord.User{}, "", fmt.Errorf("don't know a game called '%s'", gameName)
+	}
+	return target, gameID, nil
+}
+
+// watchCmd implements "!go watch <user> [<game>]".
+type watchCmd struct{}
+
+func (watchCmd) Help() string  { return "Ping you when <user> starts to play <game>" }
+func (watchCmd) Usage() string { return "watch <user> [<game>]" }
+
+func (watchCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	target, gameID, err := resolveWatchArgs(msg.GetServer(&client), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watchRegistry.Watch(msg.Author.ID, target.ID, gameID, msg.ChannelID); err != nil {
+		return nil, fmt.Errorf("couldn't save that watch: %s", err.Error())
+	}
+
+	return fmt.Sprintf("Okay, I'll let you know when %s starts playing.", target.Name), nil
+}
+
+// unwatchCmd implements "!go unwatch <user> [<game>]".
+type unwatchCmd struct{}
+
+func (unwatchCmd) Help() string  { return "Stop notifying from the watch command" }
+func (unwatchCmd) Usage() string { return "unwatch <user> [<game>]" }
+
+func (unwatchCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	target, gameID, err := resolveWatchArgs(msg.GetServer(&client), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watchRegistry.Unwatch(msg.Author.ID, target.ID, gameID); err != nil {
+		return nil, fmt.Errorf("couldn't remove that watch: %s", err.Error())
+	}
+
+	return fmt.Sprintf("Okay, I won't tell you about %s anymore.", target.Name), nil
+}
+
+// setChannelCmd implements "!go setchannel".
+type setChannelCmd struct{}
+
+func (setChannelCmd) Help() string {
+	return "Sets this channel as the server's game-start announcement channel"
+}
+func (setChannelCmd) Usage() string { return "setchannel" }
+
+func (setChannelCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	server := msg.GetServer(&client)
+	if err := watchRegistry.Store.SetAnnounceChannel(server.ID, msg.ChannelID); err != nil {
+		return nil, fmt.Errorf("couldn't save that: %s", err.Error())
+	}
+	return "Okay, I'll post game-start announcements in this channel.", nil
+}
+
+// statusCmd implements "!go status <user>".
+type statusCmd struct{}
+
+func (statusCmd) Help() string {
+	return "Shows whether <user> is currently playing something, and for how long"
+}
+func (statusCmd) Usage() string { return "status <user>" }
+
+func (statusCmd) Run(ctx context.Context, args []string, msg discord.Message) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("missing argument <user>")
+	}
+
+	server := msg.GetServer(&client)
+	target, ok := resolveTargetUser(server, args[0])
+	if !ok {
+		return nil, fmt.Errorf("couldn't find user '%s'", args[0])
+	}
+
+	pUser, inProgress := counter.Playing(target.ID)
+	if !inProgress {
+		return fmt.Sprintf("%s isn't playing anything right now.", target.Name), nil
+	}
+
+	gameName := "something"
+	if id, err := strconv.Atoi(pUser.GameID); err == nil {
+		if game, ok := games[id]; ok {
+			gameName = game.Name
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s has been playing %s for %s.",
+		target.Name,
+		gameName,
+		getDurationString(time.Now().Sub(pUser.StartTime)),
+	), nil
+}
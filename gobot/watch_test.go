@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestWatchRegistrySaveRemove(t *testing.T) {
+	store := newMemStore()
+	registry := NewWatchRegistry(store)
+
+	if err := registry.Watch("watcher", "target", "", "channel"); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+
+	watches, err := store.WatchesForTarget("target")
+	if err != nil {
+		t.Fatalf("WatchesForTarget: %s", err)
+	}
+	if len(watches) != 1 || watches[0].WatcherID != "watcher" {
+		t.Fatalf("expected one watch from 'watcher', got %v", watches)
+	}
+
+	if err := registry.Unwatch("watcher", "target", ""); err != nil {
+		t.Fatalf("Unwatch: %s", err)
+	}
+
+	watches, err = store.WatchesForTarget("target")
+	if err != nil {
+		t.Fatalf("WatchesForTarget: %s", err)
+	}
+	if len(watches) != 0 {
+		t.Fatalf("expected no watches after Unwatch, got %v", watches)
+	}
+}